@@ -0,0 +1,20 @@
+package backup
+
+import "net/url"
+
+// Destination syncs a single repository, cloned from remote into the bare
+// mirror at localPath, to one sink: the local bare mirror itself (Mirror,
+// whose Sync does the clone/fetch into localPath), a push to another Git
+// host, or a tarball archive of localPath. A single fetch can fan out to
+// several Destinations.
+type Destination interface {
+	Sync(remote url.URL, localPath string) error
+}
+
+// Sync adapts Mirror's existing Backup method to the Destination
+// interface, so the current local bare-mirror behavior is itself one of
+// the pluggable sinks.
+func (b *Mirror) Sync(remote url.URL, localPath string) error {
+	b.path = localPath
+	return b.Backup(remote, b.Verbose)
+}
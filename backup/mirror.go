@@ -2,17 +2,37 @@ package backup
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Mirror struct {
 	path string
+
+	// LFS, when true, fetches Git LFS objects after the ref fetch
+	// completes, for repositories that use them.
+	LFS bool
+
+	// Keep, when greater than zero, clones into a fresh
+	// <path>/<unix-timestamp>.git snapshot on every Backup instead of
+	// reusing a single mirror, pruning older snapshots beyond this count.
+	Keep int
+
+	// Verbose controls whether Sync streams the underlying git commands'
+	// stderr, mirroring the verbose parameter Backup already takes.
+	Verbose bool
 }
 
 func NewMirror(path string) *Mirror {
-	return &Mirror{path}
+	return &Mirror{path: path}
 }
 
 func (b *Mirror) Backup(remote url.URL, verbose bool) error {
@@ -20,14 +40,19 @@ func (b *Mirror) Backup(remote url.URL, verbose bool) error {
 		return nil
 	}
 
+	dir := b.path
+	if b.Keep > 0 {
+		dir = filepath.Join(b.path, strconv.FormatInt(time.Now().Unix(), 10)+".git")
+	}
+
 	// check whether the backup already exists
-	if stat, err := os.Stat(b.path); os.IsNotExist(err) {
-		err = os.MkdirAll(b.path, 0777)
+	if stat, err := os.Stat(dir); os.IsNotExist(err) {
+		err = os.MkdirAll(dir, 0777)
 		if err != nil {
-			return errors.New("could not create " + b.path)
+			return errors.New("could not create " + dir)
 		}
 
-		cloneCommand := exec.Command("git", "clone", "--mirror", remote.String(), b.path)
+		cloneCommand := exec.Command("git", "clone", "--mirror", remote.String(), dir)
 		if verbose {
 			cloneCommand.Stderr = os.Stderr
 		}
@@ -37,12 +62,12 @@ func (b *Mirror) Backup(remote url.URL, verbose bool) error {
 		}
 	} else {
 		if !stat.IsDir() {
-			return errors.New(b.path + " exists, but is a file")
+			return errors.New(dir + " exists, but is a file")
 		}
 	}
 
 	fetchCommand := exec.Command("git", "fetch", "--prune", "origin")
-	fetchCommand.Dir = b.path
+	fetchCommand.Dir = dir
 	if verbose {
 		fetchCommand.Stderr = os.Stderr
 	}
@@ -50,5 +75,89 @@ func (b *Mirror) Backup(remote url.URL, verbose bool) error {
 	if err != nil {
 		return err
 	}
+
+	if b.LFS && usesLFS(dir) {
+		if err := fetchLFS(dir, remote, verbose); err != nil {
+			// LFS auth/availability problems shouldn't sink an otherwise
+			// good ref backup; just report them.
+			fmt.Fprintf(os.Stderr, "LFS fetch failed for %s: %v\n", dir, err)
+		}
+	}
+
+	if b.Keep > 0 {
+		if err := b.prune(); err != nil {
+			fmt.Fprintf(os.Stderr, "pruning snapshots of %s: %v\n", b.path, err)
+		}
+	}
+
+	return nil
+}
+
+// prune removes sibling <unix-timestamp>.git snapshot directories beyond
+// the newest Keep of them.
+func (b *Mirror) prune() error {
+	entries, err := ioutil.ReadDir(b.path)
+	if err != nil {
+		return err
+	}
+
+	var snapshots []string
+	for _, entry := range entries {
+		if entry.IsDir() && isSnapshotDir(entry.Name()) {
+			snapshots = append(snapshots, entry.Name())
+		}
+	}
+
+	if len(snapshots) <= b.Keep {
+		return nil
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(snapshots))) // unix timestamps, newest first
+
+	for _, name := range snapshots[b.Keep:] {
+		if err := os.RemoveAll(filepath.Join(b.path, name)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+func isSnapshotDir(name string) bool {
+	ts := strings.TrimSuffix(name, ".git")
+	if ts == name {
+		return false
+	}
+	_, err := strconv.ParseInt(ts, 10, 64)
+	return err == nil
+}
+
+// usesLFS reports whether dir's HEAD references Git LFS, either via a
+// .lfsconfig file or a .gitattributes filter=lfs declaration. It reads only
+// the local repository, so it needs no credentials.
+func usesLFS(dir string) bool {
+	lfsConfig := exec.Command("git", "cat-file", "-e", "HEAD:.lfsconfig")
+	lfsConfig.Dir = dir
+	if lfsConfig.Run() == nil {
+		return true
+	}
+
+	attrs := exec.Command("git", "show", "HEAD:.gitattributes")
+	attrs.Dir = dir
+	out, err := attrs.Output()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(out), "filter=lfs")
+}
+
+// fetchLFS fetches through the "origin" remote rather than a bare URL so
+// git-lfs can resolve the LFS endpoint via git config, and so the
+// credentialed clone URL never appears in argv.
+func fetchLFS(dir string, remote url.URL, verbose bool) error {
+	lfsCommand := exec.Command("git", "lfs", "fetch", "--all", "origin")
+	lfsCommand.Dir = dir
+	if verbose {
+		lfsCommand.Stderr = os.Stderr
+	}
+	return lfsCommand.Run()
+}
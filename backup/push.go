@@ -0,0 +1,128 @@
+package backup
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"code.gitea.io/sdk/gitea"
+	"code.google.com/p/goauth2/oauth"
+	"github.com/google/go-github/github"
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// PushMirror pushes an already-fetched bare mirror to another Git host,
+// creating the destination repository via that host's API first if it
+// doesn't exist yet.
+type PushMirror struct {
+	// RemoteURL is the destination repository, e.g.
+	// "https://ghes.example.com/owner/repo.git".
+	RemoteURL string
+
+	// Kind selects the API used to create RemoteURL's repository if it's
+	// missing: "github", "gitlab", or "gitea".
+	Kind string
+
+	// Token authenticates both the push and the repo-creation API call.
+	Token string
+
+	Verbose bool
+}
+
+func (d *PushMirror) Sync(remote url.URL, localPath string) error {
+	dest, err := url.Parse(d.RemoteURL)
+	if err != nil {
+		return fmt.Errorf("push mirror: %v", err)
+	}
+
+	if err := d.ensureRepoExists(dest); err != nil {
+		return fmt.Errorf("push mirror: creating destination: %v", err)
+	}
+
+	authed := *dest
+	authed.User = url.UserPassword("oauth2", d.Token)
+
+	cmd := exec.Command("git", "push", "--mirror", authed.String())
+	cmd.Dir = localPath
+	if d.Verbose {
+		cmd.Stderr = os.Stderr
+	}
+	return cmd.Run()
+}
+
+// ensureRepoExists creates dest's repository via d.Kind's API, ignoring
+// the error each host's API returns when the repository already exists.
+func (d *PushMirror) ensureRepoExists(dest *url.URL) error {
+	owner, name := ownerAndRepo(dest.Path)
+
+	var err error
+	switch d.Kind {
+	case "github":
+		transport := &oauth.Transport{Token: &oauth.Token{AccessToken: d.Token}}
+		client := github.NewClient(transport.Client())
+		client.BaseURL, err = client.BaseURL.Parse("https://" + dest.Host + "/api/v3/")
+		if err != nil {
+			return err
+		}
+		_, _, err = client.Repositories.Create(owner, &github.Repository{Name: &name})
+
+	case "gitlab":
+		var client *gitlab.Client
+		client, err = gitlab.NewClient(d.Token, gitlab.WithBaseURL("https://"+dest.Host))
+		if err != nil {
+			return err
+		}
+
+		opt := &gitlab.CreateProjectOptions{Name: &name}
+		if owner != "" {
+			// A bare create puts the project in the token's personal
+			// namespace, which doesn't match a "<group>/<repo>" dest; resolve
+			// the group (or nested subgroup) to its namespace ID instead.
+			ns, _, nsErr := client.Namespaces.GetNamespace(owner)
+			if nsErr != nil {
+				return fmt.Errorf("resolving namespace %q: %v", owner, nsErr)
+			}
+			opt.NamespaceID = &ns.ID
+		}
+		_, _, err = client.Projects.CreateProject(opt)
+
+	case "gitea":
+		var client *gitea.Client
+		client, err = gitea.NewClient("https://"+dest.Host, gitea.SetToken(d.Token))
+		if err != nil {
+			return err
+		}
+		_, _, err = client.CreateRepo(gitea.CreateRepoOption{Name: name})
+
+	default:
+		return fmt.Errorf("unknown destination kind %q", d.Kind)
+	}
+
+	if err != nil && !alreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// alreadyExists reports whether err is the "repository already exists"
+// response every supported host's create-repo API returns in its own
+// wording; the push that follows will simply update such a repo.
+func alreadyExists(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already exists") ||
+		strings.Contains(msg, "already been taken") ||
+		strings.Contains(msg, "already taken")
+}
+
+// ownerAndRepo splits a URL path such as "/owner/repo.git" into its owner
+// and repository name.
+func ownerAndRepo(urlPath string) (owner, repo string) {
+	trimmed := strings.Trim(strings.TrimSuffix(urlPath, ".git"), "/")
+	idx := strings.LastIndex(trimmed, "/")
+	if idx < 0 {
+		return "", trimmed
+	}
+	return trimmed[:idx], trimmed[idx+1:]
+}
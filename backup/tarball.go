@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Tarball archives an already-fetched bare mirror as a
+// <repo>-<unix-timestamp>.tar.gz (or .tar.zst), optionally uploading it
+// to S3 afterward.
+type Tarball struct {
+	// Dir is where archives are written. Defaults to localPath's parent
+	// directory when empty.
+	Dir string
+
+	// Zstd compresses with zstd instead of gzip.
+	Zstd bool
+
+	// S3Bucket, when non-empty, uploads the archive there under its own
+	// filename and uses the default AWS credential chain.
+	S3Bucket string
+}
+
+func (d *Tarball) Sync(remote url.URL, localPath string) error {
+	dir := d.Dir
+	if dir == "" {
+		dir = filepath.Dir(localPath)
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return fmt.Errorf("tarball: %v", err)
+	}
+
+	ext := ".tar.gz"
+	if d.Zstd {
+		ext = ".tar.zst"
+	}
+	name := filepath.Base(localPath) + "-" + strconv.FormatInt(time.Now().Unix(), 10) + ext
+	archivePath := filepath.Join(dir, name)
+
+	if err := d.archive(localPath, archivePath); err != nil {
+		return fmt.Errorf("tarball: %v", err)
+	}
+
+	if d.S3Bucket != "" {
+		if err := d.upload(archivePath, name); err != nil {
+			return fmt.Errorf("tarball: uploading to s3: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Tarball) archive(localPath, archivePath string) error {
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	compressor, err := d.compressor(f)
+	if err != nil {
+		return err
+	}
+	defer compressor.Close()
+
+	tw := tar.NewWriter(compressor)
+	defer tw.Close()
+
+	return filepath.Walk(localPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name, err = filepath.Rel(localPath, path)
+		if err != nil {
+			return err
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+}
+
+// compressWriteCloser is the minimal interface both gzip.Writer and
+// zstd.Encoder satisfy.
+type compressWriteCloser interface {
+	io.WriteCloser
+}
+
+func (d *Tarball) compressor(w io.Writer) (compressWriteCloser, error) {
+	if d.Zstd {
+		return zstd.NewWriter(w)
+	}
+	return gzip.NewWriter(w), nil
+}
+
+func (d *Tarball) upload(archivePath, key string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return err
+	}
+
+	client := s3.NewFromConfig(cfg)
+	_, err = client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String(d.S3Bucket),
+		Key:    aws.String(key),
+		Body:   f,
+	})
+	return err
+}
@@ -0,0 +1,95 @@
+// Package config loads the multi-provider backup configuration used by the
+// -config flag: a YAML (or JSON, which is valid YAML) document describing
+// the list of source providers to back up.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Filter narrows the repositories a Provider emits.
+type Filter struct {
+	Owners   []string `yaml:"owners"`
+	Repos    []string `yaml:"repos"` // regular expressions matched against "owner/repo"
+	Archived bool     `yaml:"archived"`
+	Forks    bool     `yaml:"forks"`
+}
+
+// Provider describes a single source to mirror repositories from.
+type Provider struct {
+	// Type selects the implementation: "github", "gitlab", "bitbucket",
+	// "gitea", or "gogs".
+	Type string `yaml:"type"`
+
+	// URL is the API base URL for self-hosted instances (GHES, a private
+	// GitLab/Gitea/Gogs install). Left blank, github and gitlab default to
+	// their public SaaS endpoints; gitea and gogs require it. bitbucket
+	// always uses bitbucket.org and ignores it.
+	URL string `yaml:"url"`
+
+	// Token authenticates against the provider's API.
+	Token string `yaml:"token"`
+
+	// Destination overrides -to for repositories from this provider.
+	Destination string `yaml:"destination"`
+
+	// Visibility restricts repositories by visibility: "", "public", or
+	// "private". An empty value means no restriction.
+	Visibility string `yaml:"visibility"`
+
+	Include Filter `yaml:"include"`
+	Exclude Filter `yaml:"exclude"`
+
+	// Destinations lists additional sinks to fan each fetched mirror out
+	// to, beyond the primary local mirror. An empty list is the default:
+	// just the local mirror.
+	Destinations []Destination `yaml:"destinations"`
+}
+
+// Destination describes one additional sink a provider's repositories
+// should be synced to after their primary local mirror fetch.
+type Destination struct {
+	// Type selects the implementation: "push" or "tarball".
+	Type string `yaml:"type"`
+
+	// RemoteURL and Kind configure a "push" destination: the repository
+	// to push-mirror to, and the API ("github", "gitlab", or "gitea")
+	// used to create it if it doesn't already exist.
+	RemoteURL string `yaml:"remote_url"`
+	Kind      string `yaml:"kind"`
+	Token     string `yaml:"token"`
+
+	// Dir, Zstd, and S3Bucket configure a "tarball" destination.
+	Dir      string `yaml:"dir"`
+	Zstd     bool   `yaml:"zstd"`
+	S3Bucket string `yaml:"s3_bucket"`
+}
+
+// Config is the top-level shape of a -config file.
+type Config struct {
+	Providers []Provider `yaml:"providers"`
+}
+
+// Load reads and parses the configuration file at path.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", path, err)
+	}
+
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+
+	for i, p := range c.Providers {
+		if p.Type == "" {
+			return nil, fmt.Errorf("%s: providers[%d]: type is required", path, i)
+		}
+	}
+
+	return &c, nil
+}
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/url"
 	"os"
 	"path"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -14,18 +16,41 @@ import (
 	"code.google.com/p/goauth2/oauth"
 	"github.com/google/go-github/github"
 	"github.com/libgit2/git2go"
+
+	"github.com/bhcleek/github-backup/backup"
+	"github.com/bhcleek/github-backup/config"
+	"github.com/bhcleek/github-backup/metadata"
+	"github.com/bhcleek/github-backup/retry"
+	"github.com/bhcleek/github-backup/source"
 )
 
+// maxFetchAttempts bounds the exponential-backoff retry applied to each
+// repository's Mirror.Fetch: 1s, 2s, 4s, 8s between the up-to-5 attempts.
+const maxFetchAttempts = 5
+
 var VERSION = "dev" // set correctly by the linker (e.g. go build -ldflags "-X main.VERSION <semver>")
 
 var (
-	cacheFile           = flag.String("cache", "", "The access token cache file.")
-	accessToken         = flag.String("token", "", "The OAuth access token.")
-	backupDir           = flag.String("to", ".", "The base directory for repository backups.")
-	verbose             = flag.Bool("verbose", false, "Be verbose.")
-	showVersion         = flag.Bool("version", false, "Print version and exit")
-	showHelp            = flag.Bool("help", false, "Print usage and exit")
-	credentialsCallback git.CredentialsCallback
+	cacheFile    = flag.String("cache", "", "The access token cache file.")
+	accessToken  = flag.String("token", "", "The OAuth access token.")
+	configFile   = flag.String("config", "", "A YAML/JSON file describing the source providers to back up.")
+	backupDir    = flag.String("to", ".", "The base directory for repository backups.")
+	lfs          = flag.Bool("lfs", false, "Also fetch Git LFS objects for repositories that use them.")
+	parallel     = flag.Int("parallel", runtime.NumCPU(), "Maximum number of repositories to mirror concurrently.")
+	withMetadata = flag.Bool("metadata", false, "Also back up issues, pull requests, releases, labels, milestones, and the wiki for GitHub (or GHES) repositories.")
+	keep         = flag.Int("keep", 0, "Keep this many timestamped snapshots per repository instead of a single updated mirror. 0 disables snapshotting.")
+	structured   = flag.Bool("structured", false, "Lay out backups as <to>/<host>/<owner>/<repo> instead of mirroring the clone URL's path.")
+	verbose      = flag.Bool("verbose", false, "Be verbose.")
+	showVersion  = flag.Bool("version", false, "Print version and exit")
+	showHelp     = flag.Bool("help", false, "Print usage and exit")
+
+	dest        = flag.String("dest", "local", "An additional destination to fan each mirror out to beyond the local mirror: \"local\", \"push\", or \"tarball\". Ignored when -config lists its own per-provider destinations.")
+	destRemote  = flag.String("dest-remote", "", "The destination repository URL for -dest=push, e.g. https://ghes.example.com/owner/repo.git.")
+	destKind    = flag.String("dest-kind", "", "The API used to create -dest-remote's repository if it doesn't exist: \"github\", \"gitlab\", or \"gitea\".")
+	destToken   = flag.String("dest-token", "", "The token authenticating -dest-remote.")
+	tarballDir  = flag.String("tarball-dir", "", "Where -dest=tarball writes archives. Defaults to alongside the local mirror.")
+	tarballZstd = flag.Bool("tarball-zstd", false, "Compress -dest=tarball archives with zstd instead of gzip.")
+	s3Bucket    = flag.String("s3-bucket", "", "Upload -dest=tarball archives to this S3 bucket.")
 )
 
 func init() {
@@ -43,12 +68,54 @@ OPTIONS
 	-cache FILE
 	if given a token (-token TOKEN), write its value into FILE. When -token is not used, read the token to use from FILE.
 
+	-config FILE
+	use FILE, a YAML/JSON document listing one or more source providers (github, gitlab,
+	bitbucket, gitea, gogs) to back up. When given, -token and -cache are ignored.
+
 	-to DIR
 	use DIR as the base directory for backups. Defaults to the current directory.
 
+	-lfs
+	also fetch Git LFS objects for repositories that use them.
+
+	-parallel N
+	mirror at most N repositories concurrently. Defaults to the number of CPUs.
+
+	-metadata
+	also back up issues, pull requests, releases, labels, milestones, and the wiki alongside
+	each GitHub (or GHES) repository's git mirror.
+
+	-keep N
+	keep N timestamped snapshots per repository instead of a single updated mirror. Defaults to 0 (disabled).
+
+	-structured
+	lay out backups as <to>/<host>/<owner>/<repo> instead of mirroring the clone URL's path.
+
 	-verbose
 	Be verbose: log results for each repository.
 
+	-dest local|push|tarball
+	in addition to the local mirror, fan each repository out to another sink. Ignored when
+	-config lists its own per-provider destinations. Defaults to "local" (no additional sink).
+
+	-dest-remote URL
+	the destination repository for -dest=push.
+
+	-dest-kind github|gitlab|gitea
+	the API used to create -dest-remote's repository if it doesn't already exist.
+
+	-dest-token TOKEN
+	the token authenticating -dest-remote.
+
+	-tarball-dir DIR
+	where -dest=tarball writes archives. Defaults to alongside the local mirror.
+
+	-tarball-zstd
+	compress -dest=tarball archives with zstd instead of gzip.
+
+	-s3-bucket BUCKET
+	upload -dest=tarball archives to this S3 bucket.
+
 	-version
 	Print version and exit.
 `
@@ -65,7 +132,7 @@ OPTIONS
 		os.Exit(0)
 	}
 
-	if *accessToken == "" && *cacheFile == "" {
+	if *configFile == "" && *accessToken == "" && *cacheFile == "" {
 		flag.Usage()
 		os.Exit(2)
 	}
@@ -81,96 +148,247 @@ OPTIONS
 	}
 }
 
-func feedRepositoryQueue(client *github.Client, queue chan github.Repository, log chan string) {
-	defer close(queue)
-
-	opt := &github.RepositoryListOptions{}
+// loadSources builds the list of source.Source to back up from, either by
+// reading -config or, as a shorthand, by synthesizing a single GitHub
+// provider from -token/-cache.
+func loadSources() ([]source.Source, error) {
+	var providers []config.Provider
 
-	for {
-		repos, resp, err := client.Repositories.List("", opt)
+	if *configFile != "" {
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		providers = cfg.Providers
+	} else {
+		token, err := resolveToken()
+		if err != nil {
+			return nil, err
+		}
+		providers = []config.Provider{{Type: "github", Token: token}}
+	}
 
+	sources := make([]source.Source, 0, len(providers))
+	for _, p := range providers {
+		s, err := source.New(p)
 		if err != nil {
-			log <- err.Error()
-			break
+			return nil, err
 		}
+		sources = append(sources, s)
+	}
+	return sources, nil
+}
 
-		if opt.Page == 0 && len(repos) == 0 {
-			log <- "No user repositories available"
-			break
-		} else {
-			for _, repo := range repos {
-				queue <- repo
-			}
-			if resp.NextPage != 0 {
-				opt.Page = resp.NextPage
-			} else {
-				break
-			}
+// resolveToken implements the legacy -token/-cache behavior: use -token
+// directly, caching it to -cache when given, or else read the token from
+// -cache.
+func resolveToken() (string, error) {
+	if *accessToken != "" {
+		token := &oauth.Token{AccessToken: *accessToken}
+		if *cacheFile != "" {
+			cache := oauth.CacheFile(*cacheFile)
+			cache.PutToken(token)
 		}
+		return token.AccessToken, nil
 	}
 
-	orgs, _, err := client.Organizations.List("", &github.ListOptions{})
+	cache := oauth.CacheFile(*cacheFile)
+	token, err := cache.Token()
 	if err != nil {
-		log <- err.Error()
+		return "", err
 	}
 
-	for _, org := range orgs {
-		opt := &github.RepositoryListByOrgOptions{Type: "all"}
+	if *verbose {
+		log.Println("Token is cached in", cache)
+	}
 
-		for {
-			repos, resp, err := client.Repositories.ListByOrg(*org.Login, opt)
+	return token.AccessToken, nil
+}
 
-			if err != nil {
-				log <- err.Error()
-				break
-			}
+// cliDestinations builds the -dest shorthand as a single config.Destination,
+// for use when -config isn't given. It returns nil for -dest=local, which
+// needs no additional sink beyond the primary mirror.
+func cliDestinations() []config.Destination {
+	switch *dest {
+	case "", "local":
+		return nil
+	case "push":
+		return []config.Destination{{Type: "push", RemoteURL: *destRemote, Kind: *destKind, Token: *destToken}}
+	case "tarball":
+		return []config.Destination{{Type: "tarball", Dir: *tarballDir, Zstd: *tarballZstd, S3Bucket: *s3Bucket}}
+	default:
+		log.Fatalf("unknown -dest %q", *dest)
+		return nil
+	}
+}
 
-			if opt.Page == 0 && len(repos) == 0 {
-				log <- fmt.Sprintf("no %s repositories available", *org.Login)
-				break
-			} else {
-				for _, repo := range repos {
-					queue <- repo
-				}
-				if resp.NextPage != 0 {
-					opt.Page = resp.NextPage
-				} else {
-					break
-				}
+// buildDestination constructs the backup.Destination implementation a
+// config.Destination describes.
+func buildDestination(d config.Destination) (backup.Destination, error) {
+	switch d.Type {
+	case "push":
+		return &backup.PushMirror{RemoteURL: d.RemoteURL, Kind: d.Kind, Token: d.Token, Verbose: *verbose}, nil
+	case "tarball":
+		return &backup.Tarball{Dir: d.Dir, Zstd: d.Zstd, S3Bucket: d.S3Bucket}, nil
+	default:
+		return nil, fmt.Errorf("unknown destination type %q", d.Type)
+	}
+}
+
+// feedRepositoryQueue fans the repositories listed by every source into a
+// single queue.
+func feedRepositoryQueue(ctx context.Context, sources []source.Source, queue chan source.RepoRef, log chan string) {
+	defer close(queue)
+
+	wg := sync.WaitGroup{}
+	for _, s := range sources {
+		wg.Add(1)
+		go func(s source.Source) {
+			defer wg.Done()
+			for repo := range s.ListRepositories(ctx, log) {
+				queue <- repo
 			}
+		}(s)
+	}
+	wg.Wait()
+}
+
+// ownerAndRepo splits a RepoRef's "owner/repo" Name into its two parts, for
+// repositories whose owner is itself namespaced (e.g. GitLab subgroups), by
+// treating everything before the final slash as the owner.
+func ownerAndRepo(name string) (owner, repo string) {
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		return "", name
+	}
+	return name[:i], name[i+1:]
+}
+
+// githubClientFor builds a *github.Client authenticated as token, pointed at
+// host's API. host is repo.Host, so a repository discovered on a GHES
+// instance gets a client scoped to that instance's API rather than
+// github.com, mirroring how source.newGitHubSource resolves -config's
+// per-provider URL.
+func githubClientFor(host, token string) (*github.Client, error) {
+	transport := &oauth.Transport{Token: &oauth.Token{AccessToken: token}}
+	client := github.NewClient(transport.Client())
+
+	if host != "github.com" {
+		baseURL, err := client.BaseURL.Parse(fmt.Sprintf("https://%s/api/v3/", host))
+		if err != nil {
+			return nil, err
 		}
+		client.BaseURL = baseURL
 	}
+
+	return client, nil
 }
 
-func processQueue(queue chan github.Repository, verboseLog chan string, done chan int) {
+// retryableFetchError reports whether err from Mirror.Fetch is worth
+// retrying: a transient network or git-protocol hiccup, as opposed to a
+// permanent failure like a missing repository or bad credentials.
+func retryableFetchError(err error) bool {
+	msg := strings.ToLower(err.Error())
+
+	for _, permanent := range []string{"404", "401", "403", "not found", "unauthorized", "authentication"} {
+		if strings.Contains(msg, permanent) {
+			return false
+		}
+	}
+
+	for _, transient := range []string{"early eof", "rpc failed", "timeout", "connection reset", "temporary failure", "i/o timeout", "eof"} {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func processQueue(queue chan source.RepoRef, verboseLog chan string, done chan int, shorthandDestinations []config.Destination) {
 	wg := sync.WaitGroup{}
+	sem := make(chan struct{}, *parallel)
 
 	for repo := range queue {
 		wg.Add(1)
-		go func(repo github.Repository) {
-			remote, err := url.Parse(*repo.CloneURL)
+		sem <- struct{}{}
+		go func(repo source.RepoRef) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			remote, err := url.Parse(repo.CloneURL)
 			if err != nil {
-				log.Println(*repo.Name, err)
-			} else {
-				verboseLog <- fmt.Sprintf("checking %s", remote.Path[1:])
+				log.Println(repo.Name, err)
+				return
+			}
+			remote.User = url.UserPassword(repo.Username, repo.Token)
+
+			verboseLog <- fmt.Sprintf("checking %s", repo.Name)
+
+			base := *backupDir
+			if repo.Destination != "" {
+				base = repo.Destination
+			}
 
+			var mirrorPath string
+			if *structured {
+				owner, name := ownerAndRepo(repo.Name)
+				mirrorPath = path.Join(base, repo.Host, owner, name)
+			} else {
 				mirrorPathSegments := make([]string, 0, 4)
-				mirrorPathSegments = append(mirrorPathSegments, *backupDir)
-				host := strings.Split(remote.Host, ":")[0] // strip off the port portion if it's there.
-				mirrorPathSegments = append(mirrorPathSegments, host)
+				mirrorPathSegments = append(mirrorPathSegments, base)
+				mirrorPathSegments = append(mirrorPathSegments, repo.Host)
 				mirrorPathSegments = append(mirrorPathSegments, strings.Split(remote.Path, "/")...)
-				mirrorPath := path.Join(mirrorPathSegments...)
+				mirrorPath = path.Join(mirrorPathSegments...)
+			}
+
+			credentialsCallback := func(url string, usernameFromURL string, allowedType git.CredType) (int, *git.Cred) {
+				i, c := git.NewCredUserpassPlaintext(repo.Username, repo.Token)
+				return i, &c
+			}
+
+			mirror := NewMirror(mirrorPath, *remote, credentialsCallback)
+			mirror.LFS = *lfs
+			mirror.Keep = *keep
+			mirror.VerboseLog = verboseLog
+
+			attempts, err := retry.Do(maxFetchAttempts, retryableFetchError, mirror.Fetch)
+			if attempts > 1 {
+				verboseLog <- fmt.Sprintf("%s took %d attempts", repo.Name, attempts)
+			}
+
+			if err != nil {
+				log.Println(repo.Name, err)
+				return
+			}
+			verboseLog <- fmt.Sprintf("%s complete", repo.Name)
 
-				mirror := NewMirror(mirrorPath, *remote, credentialsCallback)
-				err = mirror.Fetch()
+			if *withMetadata {
+				owner, name := ownerAndRepo(repo.Name)
+				client, err := githubClientFor(repo.Host, repo.Token)
+				if err != nil {
+					log.Println(repo.Name, "metadata:", err)
+				} else if err := metadata.Sync(client, owner, name, mirrorPath, repo.CloneURL, *verbose); err != nil {
+					log.Println(repo.Name, "metadata:", err)
+				}
+			}
 
+			destinations := repo.Destinations
+			if len(destinations) == 0 {
+				destinations = shorthandDestinations
+			}
+			for _, cfg := range destinations {
+				d, err := buildDestination(cfg)
 				if err != nil {
-					log.Println(remote.Path, err)
+					log.Println(repo.Name, err)
+					continue
+				}
+				if err := d.Sync(*remote, mirrorPath); err != nil {
+					log.Println(repo.Name, cfg.Type, err)
 				} else {
-					verboseLog <- fmt.Sprintf("%s complete", remote.Path[1:])
+					verboseLog <- fmt.Sprintf("%s synced to %s", repo.Name, cfg.Type)
 				}
 			}
-			wg.Done()
 		}(repo)
 	}
 
@@ -179,58 +397,13 @@ func processQueue(queue chan github.Repository, verboseLog chan string, done cha
 }
 
 func main() {
-	var (
-		err       error
-		token     *oauth.Token
-		transport *oauth.Transport
-		cache     oauth.Cache
-	)
-
-	config := &oauth.Config{}
-
-	if *accessToken == "" {
-		cache = oauth.CacheFile(*cacheFile)
-
-		token, err = cache.Token()
-
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		if *verbose {
-			log.Println("Token is cached in", cache)
-		}
-	} else {
-		token = &oauth.Token{AccessToken: *accessToken}
-
-		if *cacheFile != "" {
-			cache = oauth.CacheFile(*cacheFile)
-			cache.PutToken(token)
-		}
-	}
-
-	transport = &oauth.Transport{Config: config}
-	transport.Token = token
-
-	client := github.NewClient(transport.Client())
-
-	user, _, err := client.Users.Get("")
+	sources, err := loadSources()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if *verbose {
-		log.Println("Retrieving information from GitHub using credentials of", *user.Login)
-	}
-
-	credentialsCallback = func(url string, username_from_url string, allowed_type git.CredType) (int, *git.Cred) {
-		log.Println(username_from_url)
-		i, c := git.NewCredUserpassPlaintext(*user.Login, token.AccessToken)
-		return i, &c
-	}
-
 	msgQueue := make(chan string)
-	queue := make(chan github.Repository)
+	queue := make(chan source.RepoRef)
 	done := make(chan int)
 
 	go func(verbose bool, c chan string) {
@@ -242,8 +415,8 @@ func main() {
 		}
 	}(*verbose, msgQueue)
 
-	go feedRepositoryQueue(client, queue, msgQueue)
-	go processQueue(queue, msgQueue, done)
+	go feedRepositoryQueue(context.Background(), sources, queue, msgQueue)
+	go processQueue(queue, msgQueue, done, cliDestinations())
 
 	for {
 		select {
@@ -0,0 +1,388 @@
+// Package metadata captures the parts of a GitHub repository that live
+// outside its git refs: description/topics, issues, pull requests,
+// releases (with assets), labels, milestones, and the wiki. Sync writes
+// all of it as a JSON sidecar tree next to a repository's mirror
+// directory, reusing the previous run's ETag to skip a collection when
+// it fits on one page and hasn't changed.
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/google/go-github/github"
+)
+
+// Sync writes owner/repo's metadata into <mirrorPath>.metadata.
+func Sync(client *github.Client, owner, repo, mirrorPath, cloneURL string, verbose bool) error {
+	dir := mirrorPath + ".metadata"
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return fmt.Errorf("could not create %s: %v", dir, err)
+	}
+
+	state, err := loadState(dir)
+	if err != nil {
+		return err
+	}
+
+	syncers := []func(*github.Client, string, string, string, *etagState) error{
+		syncRepository,
+		syncIssues,
+		syncPullRequests,
+		syncReleases,
+		syncLabels,
+		syncMilestones,
+	}
+
+	for _, sync := range syncers {
+		if err := sync(client, owner, repo, dir, state); err != nil {
+			return err
+		}
+	}
+
+	syncWiki(cloneURL, dir, verbose)
+
+	return state.save(dir)
+}
+
+// etagState records the ETag seen for each metadata collection's first
+// page, so a later Sync can issue a conditional GET and skip collections
+// that haven't changed.
+type etagState struct {
+	ETags map[string]string `json:"etags"`
+}
+
+func loadState(dir string) (*etagState, error) {
+	s := &etagState{ETags: map[string]string{}}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "etags.json"))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *etagState) save(dir string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "etags.json"), data, 0666)
+}
+
+// conditional issues a GET for url, recording the response's ETag under
+// key only when that page is the whole collection (no next page), and
+// forgetting any recorded ETag otherwise. It reports unchanged=true when
+// the server replied 304 Not Modified, meaning the caller can skip
+// re-fetching the collection. url
+// must carry the same per_page as the pagination loop it guards, or a
+// 304 on a differently-sized first page would wrongly skip later pages
+// too.
+func conditional(client *github.Client, state *etagState, key, url string) (unchanged bool, err error) {
+	req, err := client.NewRequest("GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	if etag, ok := state.ETags[key]; ok {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := client.Do(req, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotModified {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" && resp.NextPage == 0 {
+		state.ETags[key] = etag
+	} else {
+		delete(state.ETags, key)
+	}
+	return false, nil
+}
+
+func writeJSON(dir, name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, name), data, 0666)
+}
+
+func syncRepository(client *github.Client, owner, repo, dir string, state *etagState) error {
+	r, _, err := client.Repositories.Get(owner, repo)
+	if err != nil {
+		return fmt.Errorf("repository: %v", err)
+	}
+	return writeJSON(dir, "repository.json", r)
+}
+
+type issueWithComments struct {
+	github.Issue
+	IssueComments []github.IssueComment `json:"comments"`
+}
+
+// syncIssues isn't ETag-gated: a comment added to an issue past page 1
+// leaves page 1's own ETag unchanged, so gating the whole collection on it
+// would silently miss that update on repos with more than a page of
+// issues.
+func syncIssues(client *github.Client, owner, repo, dir string, state *etagState) error {
+	opt := &github.IssueListByRepoOptions{State: "all", ListOptions: github.ListOptions{PerPage: 100}}
+
+	var out []issueWithComments
+	for {
+		issues, resp, err := client.Issues.ListByRepo(owner, repo, opt)
+		if err != nil {
+			return fmt.Errorf("issues: %v", err)
+		}
+
+		for _, issue := range issues {
+			comments, err := allIssueComments(client, owner, repo, *issue.Number)
+			if err != nil {
+				return fmt.Errorf("issue #%d comments: %v", *issue.Number, err)
+			}
+			out = append(out, issueWithComments{issue, comments})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return writeJSON(dir, "issues.json", out)
+}
+
+func allIssueComments(client *github.Client, owner, repo string, number int) ([]github.IssueComment, error) {
+	opt := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+
+	var all []github.IssueComment
+	for {
+		comments, resp, err := client.Issues.ListComments(owner, repo, number, opt)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, comments...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return all, nil
+}
+
+type pullRequestDetail struct {
+	github.PullRequest
+	ReviewComments []github.PullRequestComment `json:"review_comments"`
+	Commits        []github.RepositoryCommit   `json:"commits"`
+}
+
+// syncPullRequests isn't ETag-gated, for the same reason as syncIssues: a
+// review comment on a PR past page 1 wouldn't change page 1's ETag.
+func syncPullRequests(client *github.Client, owner, repo, dir string, state *etagState) error {
+	opt := &github.PullRequestListOptions{State: "all", ListOptions: github.ListOptions{PerPage: 100}}
+
+	var out []pullRequestDetail
+	for {
+		pulls, resp, err := client.PullRequests.List(owner, repo, opt)
+		if err != nil {
+			return fmt.Errorf("pull requests: %v", err)
+		}
+
+		for _, pr := range pulls {
+			reviewComments, err := allReviewComments(client, owner, repo, *pr.Number)
+			if err != nil {
+				return fmt.Errorf("pr #%d review comments: %v", *pr.Number, err)
+			}
+			commits, err := allPullRequestCommits(client, owner, repo, *pr.Number)
+			if err != nil {
+				return fmt.Errorf("pr #%d commits: %v", *pr.Number, err)
+			}
+			out = append(out, pullRequestDetail{pr, reviewComments, commits})
+		}
+
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return writeJSON(dir, "pull_requests.json", out)
+}
+
+func allReviewComments(client *github.Client, owner, repo string, number int) ([]github.PullRequestComment, error) {
+	opt := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+
+	var all []github.PullRequestComment
+	for {
+		comments, resp, err := client.PullRequests.ListComments(owner, repo, number, opt)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, comments...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return all, nil
+}
+
+func allPullRequestCommits(client *github.Client, owner, repo string, number int) ([]github.RepositoryCommit, error) {
+	opt := &github.ListOptions{PerPage: 100}
+
+	var all []github.RepositoryCommit
+	for {
+		commits, resp, err := client.PullRequests.ListCommits(owner, repo, number, opt)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, commits...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return all, nil
+}
+
+func syncReleases(client *github.Client, owner, repo, dir string, state *etagState) error {
+	key := "releases"
+	unchanged, err := conditional(client, state, key, fmt.Sprintf("repos/%s/%s/releases?per_page=100", owner, repo))
+	if err != nil {
+		return fmt.Errorf("releases: %v", err)
+	}
+	if unchanged {
+		return nil
+	}
+
+	opt := &github.ListOptions{PerPage: 100}
+
+	var releases []github.RepositoryRelease
+	for {
+		page, resp, err := client.Repositories.ListReleases(owner, repo, opt)
+		if err != nil {
+			return fmt.Errorf("releases: %v", err)
+		}
+		releases = append(releases, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	assetsDir := filepath.Join(dir, "releases")
+	for _, release := range releases {
+		for _, asset := range release.Assets {
+			if err := downloadAsset(client, owner, repo, assetsDir, *release.TagName, asset); err != nil {
+				return fmt.Errorf("release %s asset %s: %v", *release.TagName, *asset.Name, err)
+			}
+		}
+	}
+
+	return writeJSON(dir, "releases.json", releases)
+}
+
+func downloadAsset(client *github.Client, owner, repo, assetsDir, tag string, asset github.ReleaseAsset) error {
+	if asset.ID == nil {
+		return nil
+	}
+
+	destDir := filepath.Join(assetsDir, tag)
+	if err := os.MkdirAll(destDir, 0777); err != nil {
+		return err
+	}
+
+	// DownloadReleaseAsset authenticates the initial API request with
+	// client's token, so it also works for assets on private
+	// repositories, unlike a bare GET of BrowserDownloadURL.
+	rc, err := client.Repositories.DownloadReleaseAsset(owner, repo, *asset.ID, http.DefaultClient)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	f, err := os.Create(filepath.Join(destDir, *asset.Name))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, rc)
+	return err
+}
+
+func syncLabels(client *github.Client, owner, repo, dir string, state *etagState) error {
+	opt := &github.ListOptions{PerPage: 100}
+
+	var labels []github.Label
+	for {
+		page, resp, err := client.Issues.ListLabels(owner, repo, opt)
+		if err != nil {
+			return fmt.Errorf("labels: %v", err)
+		}
+		labels = append(labels, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return writeJSON(dir, "labels.json", labels)
+}
+
+func syncMilestones(client *github.Client, owner, repo, dir string, state *etagState) error {
+	opt := &github.MilestoneListOptions{State: "all", ListOptions: github.ListOptions{PerPage: 100}}
+
+	var milestones []github.Milestone
+	for {
+		page, resp, err := client.Issues.ListMilestones(owner, repo, opt)
+		if err != nil {
+			return fmt.Errorf("milestones: %v", err)
+		}
+		milestones = append(milestones, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return writeJSON(dir, "milestones.json", milestones)
+}
+
+// syncWiki clones or fetches the repository's wiki into dir/wiki. Most
+// repositories have no wiki, so a clone failure here is not treated as an
+// error; it is logged only when verbose is set.
+func syncWiki(cloneURL, dir string, verbose bool) {
+	wikiURL := cloneURL[:len(cloneURL)-len(".git")] + ".wiki.git"
+	wikiDir := filepath.Join(dir, "wiki")
+
+	var cmd *exec.Cmd
+	if _, err := os.Stat(wikiDir); os.IsNotExist(err) {
+		cmd = exec.Command("git", "clone", "--mirror", wikiURL, wikiDir)
+	} else {
+		cmd = exec.Command("git", "fetch", "--prune", "origin")
+		cmd.Dir = wikiDir
+	}
+
+	if verbose {
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil && verbose {
+		fmt.Fprintf(os.Stderr, "no wiki for %s: %v\n", cloneURL, err)
+	}
+}
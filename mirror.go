@@ -2,8 +2,16 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/libgit2/git2go"
 )
@@ -12,13 +20,26 @@ type Mirror struct {
 	path                string
 	remote              url.URL
 	credentialsCallback git.CredentialsCallback
+
+	// LFS, when true, fetches Git LFS objects after the ref fetch
+	// completes, for repositories that use them.
+	LFS bool
+
+	// Keep, when greater than zero, clones into a fresh
+	// <path>/<unix-timestamp>.git snapshot on every Fetch instead of
+	// reusing a single mirror, pruning older snapshots beyond this count.
+	Keep int
+
+	// VerboseLog, when set, receives LFS progress/error messages so an LFS
+	// failure can be reported without failing the repository's backup.
+	VerboseLog chan<- string
 }
 
 func NewMirror(path string, remote url.URL, credentialsCallback git.CredentialsCallback) *Mirror {
 	return &Mirror{
-		path,
-		remote,
-		credentialsCallback,
+		path:                path,
+		remote:              remote,
+		credentialsCallback: credentialsCallback,
 	}
 }
 
@@ -27,11 +48,16 @@ func (b *Mirror) Fetch() error {
 		return nil
 	}
 
+	dir := b.path
+	if b.Keep > 0 {
+		dir = filepath.Join(b.path, strconv.FormatInt(time.Now().Unix(), 10)+".git")
+	}
+
 	// check whether the backup already exists
-	if stat, err := os.Stat(b.path); os.IsNotExist(err) {
-		err = os.MkdirAll(b.path, 0777)
+	if stat, err := os.Stat(dir); os.IsNotExist(err) {
+		err = os.MkdirAll(dir, 0777)
 		if err != nil {
-			return errors.New("could not create " + b.path)
+			return errors.New("could not create " + dir)
 		}
 
 		opt := &git.CloneOptions{
@@ -40,17 +66,17 @@ func (b *Mirror) Fetch() error {
 			},
 			Bare: true,
 		}
-		_, err := git.Clone(b.remote.String(), b.path, opt)
+		_, err := git.Clone(b.remote.String(), dir, opt)
 		if err != nil {
 			return err
 		}
 	} else {
 		if !stat.IsDir() {
-			return errors.New(b.path + " exists, but is a file")
+			return errors.New(dir + " exists, but is a file")
 		}
 	}
 
-	repo, err := git.OpenRepository(b.path)
+	repo, err := git.OpenRepository(dir)
 	if err != nil {
 		return err
 	}
@@ -60,5 +86,114 @@ func (b *Mirror) Fetch() error {
 		return err
 	}
 	err = remote.Fetch(nil, "")
-	return err
+	if err != nil {
+		return err
+	}
+
+	if b.LFS && repoUsesLFS(repo) {
+		if err := b.fetchLFS(dir); err != nil {
+			b.logVerbose(fmt.Sprintf("LFS fetch failed for %s: %v", dir, err))
+		}
+	}
+
+	if b.Keep > 0 {
+		if err := b.prune(); err != nil {
+			b.logVerbose(fmt.Sprintf("pruning snapshots of %s: %v", b.path, err))
+		}
+	}
+
+	return nil
+}
+
+// fetchLFS shells out to "git lfs fetch --all origin", since git2go has no
+// LFS support of its own. It fetches through the "origin" remote rather
+// than a bare URL so git-lfs can resolve the LFS endpoint via git config,
+// and so the credentialed clone URL never appears in argv.
+func (b *Mirror) fetchLFS(dir string) error {
+	cmd := exec.Command("git", "lfs", "fetch", "--all", "origin")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// prune removes sibling <unix-timestamp>.git snapshot directories beyond
+// the newest Keep of them.
+func (b *Mirror) prune() error {
+	entries, err := ioutil.ReadDir(b.path)
+	if err != nil {
+		return err
+	}
+
+	var snapshots []string
+	for _, entry := range entries {
+		if entry.IsDir() && isSnapshotDir(entry.Name()) {
+			snapshots = append(snapshots, entry.Name())
+		}
+	}
+
+	if len(snapshots) <= b.Keep {
+		return nil
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(snapshots))) // unix timestamps, newest first
+
+	for _, name := range snapshots[b.Keep:] {
+		if err := os.RemoveAll(filepath.Join(b.path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isSnapshotDir(name string) bool {
+	ts := strings.TrimSuffix(name, ".git")
+	if ts == name {
+		return false
+	}
+	_, err := strconv.ParseInt(ts, 10, 64)
+	return err == nil
+}
+
+func (b *Mirror) logVerbose(msg string) {
+	if b.VerboseLog != nil {
+		b.VerboseLog <- msg
+	}
+}
+
+// repoUsesLFS reports whether repo's HEAD tree references Git LFS, either
+// via a .lfsconfig file or a .gitattributes filter=lfs declaration.
+func repoUsesLFS(repo *git.Repository) bool {
+	head, err := repo.Head()
+	if err != nil {
+		return false
+	}
+
+	commit, err := repo.LookupCommit(head.Target())
+	if err != nil {
+		return false
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return false
+	}
+
+	if entry, err := tree.EntryByPath(".lfsconfig"); err == nil && entry != nil {
+		return true
+	}
+
+	entry, err := tree.EntryByPath(".gitattributes")
+	if err != nil || entry == nil {
+		return false
+	}
+
+	blob, err := repo.LookupBlob(entry.Id)
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(string(blob.Contents()), "filter=lfs")
 }
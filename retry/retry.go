@@ -0,0 +1,29 @@
+// Package retry implements a small exponential-backoff helper shared by
+// the provider API calls and the git fetch path.
+package retry
+
+import "time"
+
+// Do calls fn, retrying with exponential backoff (1s, 2s, 4s, 8s, ...)
+// while isRetryable(err) reports true, up to maxAttempts total calls. It
+// returns the number of attempts made and the error from the final
+// attempt (nil on success).
+func Do(maxAttempts int, isRetryable func(error) bool, fn func() error) (attempts int, err error) {
+	wait := time.Second
+
+	for attempts = 1; attempts <= maxAttempts; attempts++ {
+		err = fn()
+		if err == nil {
+			return attempts, nil
+		}
+
+		if attempts == maxAttempts || !isRetryable(err) {
+			return attempts, err
+		}
+
+		time.Sleep(wait)
+		wait *= 2
+	}
+
+	return attempts, err
+}
@@ -0,0 +1,85 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	bitbucket "github.com/ktrysmt/go-bitbucket"
+
+	"github.com/bhcleek/github-backup/config"
+)
+
+type bitbucketSource struct {
+	client       *bitbucket.Client
+	filter       *filter
+	owners       []string
+	token        string
+	dest         string
+	destinations []config.Destination
+}
+
+func newBitbucketSource(p config.Provider) (Source, error) {
+	f, err := newFilter(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.Include.Owners) == 0 {
+		return nil, fmt.Errorf("bitbucket: include.owners must list at least one workspace")
+	}
+
+	client := bitbucket.NewOAuthbearerToken(p.Token)
+
+	return &bitbucketSource{
+		client:       client,
+		filter:       f,
+		owners:       p.Include.Owners,
+		token:        p.Token,
+		dest:         p.Destination,
+		destinations: p.Destinations,
+	}, nil
+}
+
+func (s *bitbucketSource) ListRepositories(ctx context.Context, log chan<- string) <-chan RepoRef {
+	queue := make(chan RepoRef)
+
+	go func() {
+		defer close(queue)
+
+		for _, workspace := range s.owners {
+			page := 1
+			for {
+				res, err := s.client.Repositories.ListForAccount(&bitbucket.RepositoriesOptions{Owner: workspace, Page: &page})
+				if err != nil {
+					log <- err.Error()
+					break
+				}
+
+				if len(res.Items) == 0 {
+					break
+				}
+
+				for _, repo := range res.Items {
+					if !s.filter.allow(workspace, repo.Slug, false, repo.Parent != nil, repo.Is_private) {
+						continue
+					}
+
+					cloneURL := fmt.Sprintf("https://bitbucket.org/%s/%s.git", workspace, repo.Slug)
+					queue <- RepoRef{
+						Name:         workspace + "/" + repo.Slug,
+						CloneURL:     cloneURL,
+						Host:         "bitbucket.org",
+						Username:     "x-token-auth",
+						Token:        s.token,
+						Destination:  s.dest,
+						Destinations: s.destinations,
+					}
+				}
+
+				page++
+			}
+		}
+	}()
+
+	return queue
+}
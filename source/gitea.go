@@ -0,0 +1,80 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"code.gitea.io/sdk/gitea"
+
+	"github.com/bhcleek/github-backup/config"
+)
+
+type giteaSource struct {
+	client       *gitea.Client
+	filter       *filter
+	token        string
+	dest         string
+	destinations []config.Destination
+}
+
+func newGiteaSource(p config.Provider) (Source, error) {
+	f, err := newFilter(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.URL == "" {
+		return nil, fmt.Errorf("gitea: url is required")
+	}
+
+	client, err := gitea.NewClient(p.URL, gitea.SetToken(p.Token))
+	if err != nil {
+		return nil, fmt.Errorf("gitea: %v", err)
+	}
+
+	return &giteaSource{client: client, filter: f, token: p.Token, dest: p.Destination, destinations: p.Destinations}, nil
+}
+
+func (s *giteaSource) ListRepositories(ctx context.Context, log chan<- string) <-chan RepoRef {
+	queue := make(chan RepoRef)
+
+	go func() {
+		defer close(queue)
+
+		page := 1
+		for {
+			repos, _, err := s.client.ListMyRepos(gitea.ListReposOptions{
+				ListOptions: gitea.ListOptions{Page: page, PageSize: 50},
+			})
+			if err != nil {
+				log <- err.Error()
+				return
+			}
+
+			if len(repos) == 0 {
+				break
+			}
+
+			for _, repo := range repos {
+				owner := repo.Owner.UserName
+				if !s.filter.allow(owner, repo.Name, repo.Archived, repo.Fork, repo.Private) {
+					continue
+				}
+
+				queue <- RepoRef{
+					Name:         owner + "/" + repo.Name,
+					CloneURL:     repo.CloneURL,
+					Host:         hostOf(s.client.GetBaseURL()),
+					Username:     "oauth2",
+					Token:        s.token,
+					Destination:  s.dest,
+					Destinations: s.destinations,
+				}
+			}
+
+			page++
+		}
+	}()
+
+	return queue
+}
@@ -0,0 +1,191 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"code.google.com/p/goauth2/oauth"
+	"github.com/google/go-github/github"
+
+	"github.com/bhcleek/github-backup/config"
+	"github.com/bhcleek/github-backup/retry"
+)
+
+// rateLimitThreshold is the Remaining count at or below which the source
+// pauses until GitHub's rate limit resets, rather than burning through
+// the last few requests and getting a hard 403.
+const rateLimitThreshold = 10
+
+// maxAPIAttempts bounds the exponential-backoff retry applied to each
+// paginated API call: 1s, 2s, 4s, 8s between the up-to-5 attempts.
+const maxAPIAttempts = 5
+
+type gitHubSource struct {
+	client       *github.Client
+	filter       *filter
+	username     string
+	token        string
+	dest         string
+	destinations []config.Destination
+	rateLimiter  *RateLimiter
+}
+
+func newGitHubSource(p config.Provider) (Source, error) {
+	f, err := newFilter(p)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &oauth.Transport{Token: &oauth.Token{AccessToken: p.Token}}
+	client := github.NewClient(transport.Client())
+	if p.URL != "" {
+		baseURL, err := client.BaseURL.Parse(p.URL)
+		if err != nil {
+			return nil, fmt.Errorf("github: parsing url: %v", err)
+		}
+		client.BaseURL = baseURL
+	}
+
+	user, _, err := client.Users.Get("")
+	if err != nil {
+		return nil, fmt.Errorf("github: authenticating: %v", err)
+	}
+
+	return &gitHubSource{
+		client:       client,
+		filter:       f,
+		username:     *user.Login,
+		token:        p.Token,
+		dest:         p.Destination,
+		destinations: p.Destinations,
+		rateLimiter:  NewRateLimiter(rateLimitThreshold),
+	}, nil
+}
+
+// retryableAPIError reports whether err is worth retrying: a transient
+// network error or an HTTP 5xx, as opposed to a permanent 404/401/403.
+func retryableAPIError(err error) bool {
+	if ghErr, ok := err.(*github.ErrorResponse); ok {
+		return ghErr.Response != nil && ghErr.Response.StatusCode >= 500
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return false
+}
+
+func (s *gitHubSource) ListRepositories(ctx context.Context, log chan<- string) <-chan RepoRef {
+	queue := make(chan RepoRef)
+
+	go func() {
+		defer close(queue)
+
+		opt := &github.RepositoryListOptions{}
+		for {
+			var repos []github.Repository
+			var resp *github.Response
+			attempts, err := retry.Do(maxAPIAttempts, retryableAPIError, func() error {
+				var callErr error
+				repos, resp, callErr = s.client.Repositories.List("", opt)
+				return callErr
+			})
+			if attempts > 1 {
+				log <- fmt.Sprintf("listing repositories took %d attempts", attempts)
+			}
+			if err != nil {
+				log <- err.Error()
+				break
+			}
+			s.rateLimiter.Wait(resp, log)
+
+			if opt.Page == 0 && len(repos) == 0 {
+				log <- "No user repositories available"
+				break
+			}
+
+			s.emit(repos, queue)
+			if resp.NextPage == 0 {
+				break
+			}
+			opt.Page = resp.NextPage
+		}
+
+		var orgs []github.Organization
+		var orgsResp *github.Response
+		attempts, err := retry.Do(maxAPIAttempts, retryableAPIError, func() error {
+			var callErr error
+			orgs, orgsResp, callErr = s.client.Organizations.List("", &github.ListOptions{})
+			return callErr
+		})
+		if attempts > 1 {
+			log <- fmt.Sprintf("listing organizations took %d attempts", attempts)
+		}
+		if err != nil {
+			log <- err.Error()
+			return
+		}
+		s.rateLimiter.Wait(orgsResp, log)
+
+		for _, org := range orgs {
+			opt := &github.RepositoryListByOrgOptions{Type: "all"}
+			for {
+				var repos []github.Repository
+				var resp *github.Response
+				attempts, err := retry.Do(maxAPIAttempts, retryableAPIError, func() error {
+					var callErr error
+					repos, resp, callErr = s.client.Repositories.ListByOrg(*org.Login, opt)
+					return callErr
+				})
+				if attempts > 1 {
+					log <- fmt.Sprintf("listing %s repositories took %d attempts", *org.Login, attempts)
+				}
+				if err != nil {
+					log <- err.Error()
+					break
+				}
+				s.rateLimiter.Wait(resp, log)
+
+				if opt.Page == 0 && len(repos) == 0 {
+					log <- fmt.Sprintf("no %s repositories available", *org.Login)
+					break
+				}
+
+				s.emit(repos, queue)
+				if resp.NextPage == 0 {
+					break
+				}
+				opt.Page = resp.NextPage
+			}
+		}
+	}()
+
+	return queue
+}
+
+func (s *gitHubSource) emit(repos []github.Repository, queue chan<- RepoRef) {
+	for _, repo := range repos {
+		owner := ""
+		if repo.Owner != nil && repo.Owner.Login != nil {
+			owner = *repo.Owner.Login
+		}
+
+		archived := false // go-github at this vintage doesn't expose Archived; treat all repos as active.
+		private := repo.Private != nil && *repo.Private
+		fork := repo.Fork != nil && *repo.Fork
+
+		if !s.filter.allow(owner, *repo.Name, archived, fork, private) {
+			continue
+		}
+
+		queue <- RepoRef{
+			Name:         owner + "/" + *repo.Name,
+			CloneURL:     *repo.CloneURL,
+			Host:         hostOf(*repo.CloneURL),
+			Username:     s.username,
+			Token:        s.token,
+			Destination:  s.dest,
+			Destinations: s.destinations,
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bhcleek/github-backup/config"
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+type gitLabSource struct {
+	client       *gitlab.Client
+	filter       *filter
+	token        string
+	dest         string
+	destinations []config.Destination
+}
+
+func newGitLabSource(p config.Provider) (Source, error) {
+	f, err := newFilter(p)
+	if err != nil {
+		return nil, err
+	}
+
+	var client *gitlab.Client
+	if p.URL != "" {
+		client, err = gitlab.NewClient(p.Token, gitlab.WithBaseURL(p.URL))
+	} else {
+		client, err = gitlab.NewClient(p.Token)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gitlab: %v", err)
+	}
+
+	return &gitLabSource{client: client, filter: f, token: p.Token, dest: p.Destination, destinations: p.Destinations}, nil
+}
+
+func (s *gitLabSource) ListRepositories(ctx context.Context, log chan<- string) <-chan RepoRef {
+	queue := make(chan RepoRef)
+
+	go func() {
+		defer close(queue)
+
+		opt := &gitlab.ListProjectsOptions{
+			ListOptions: gitlab.ListOptions{PerPage: 100},
+			Membership:  gitlab.Bool(true),
+		}
+
+		for {
+			projects, resp, err := s.client.Projects.ListProjects(opt)
+			if err != nil {
+				log <- err.Error()
+				return
+			}
+
+			for _, project := range projects {
+				owner := project.Namespace.Path
+				if !s.filter.allow(owner, project.Path, project.Archived, project.ForkedFromProject != nil, project.Visibility != gitlab.PublicVisibility) {
+					continue
+				}
+
+				queue <- RepoRef{
+					Name:         project.PathWithNamespace,
+					CloneURL:     project.HTTPURLToRepo,
+					Host:         hostOf(project.WebURL),
+					Username:     "oauth2",
+					Token:        s.token,
+					Destination:  s.dest,
+					Destinations: s.destinations,
+				}
+			}
+
+			if resp.NextPage == 0 {
+				break
+			}
+			opt.Page = resp.NextPage
+		}
+	}()
+
+	return queue
+}
@@ -0,0 +1,69 @@
+package source
+
+import (
+	"context"
+	"fmt"
+
+	gogs "github.com/gogs/go-gogs-client"
+
+	"github.com/bhcleek/github-backup/config"
+)
+
+type gogsSource struct {
+	client       *gogs.Client
+	filter       *filter
+	token        string
+	dest         string
+	host         string
+	destinations []config.Destination
+}
+
+func newGogsSource(p config.Provider) (Source, error) {
+	f, err := newFilter(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.URL == "" {
+		return nil, fmt.Errorf("gogs: url is required")
+	}
+
+	client := gogs.NewClient(p.URL, p.Token)
+
+	return &gogsSource{client: client, filter: f, token: p.Token, dest: p.Destination, host: hostOf(p.URL), destinations: p.Destinations}, nil
+}
+
+// Gogs has no server-side repository listing beyond the authenticated
+// user's own repos, so that is all this Source can offer.
+func (s *gogsSource) ListRepositories(ctx context.Context, log chan<- string) <-chan RepoRef {
+	queue := make(chan RepoRef)
+
+	go func() {
+		defer close(queue)
+
+		repos, err := s.client.ListMyRepos()
+		if err != nil {
+			log <- err.Error()
+			return
+		}
+
+		for _, repo := range repos {
+			owner := repo.Owner.UserName
+			if !s.filter.allow(owner, repo.Name, false, repo.Fork, repo.Private) {
+				continue
+			}
+
+			queue <- RepoRef{
+				Name:         owner + "/" + repo.Name,
+				CloneURL:     repo.CloneURL,
+				Host:         s.host,
+				Username:     "oauth2",
+				Token:        s.token,
+				Destination:  s.dest,
+				Destinations: s.destinations,
+			}
+		}
+	}()
+
+	return queue
+}
@@ -0,0 +1,43 @@
+package source
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// RateLimiter pauses between API calls to stay under a provider's rate
+// limit, inspecting the Rate reported on each github.Response.
+type RateLimiter struct {
+	// Threshold is the Remaining count at or below which Wait blocks
+	// until Reset.
+	Threshold int
+
+	// sleep performs the pause; NewRateLimiter sets it to time.Sleep.
+	sleep func(time.Duration)
+}
+
+// NewRateLimiter returns a RateLimiter that pauses once Remaining drops to
+// threshold or below.
+func NewRateLimiter(threshold int) *RateLimiter {
+	return &RateLimiter{Threshold: threshold, sleep: time.Sleep}
+}
+
+// Wait blocks until resp's reported rate limit has headroom for another
+// call, logging the pause on log when one is taken.
+func (r *RateLimiter) Wait(resp *github.Response, log chan<- string) {
+	if r == nil || resp == nil || resp.Rate.Remaining > r.Threshold {
+		return
+	}
+
+	wait := time.Until(resp.Rate.Reset.Time)
+	if wait <= 0 {
+		return
+	}
+
+	if log != nil {
+		log <- fmt.Sprintf("rate limit: %d/%d remaining, sleeping %s until reset", resp.Rate.Remaining, resp.Rate.Limit, wait.Round(time.Second))
+	}
+	r.sleep(wait)
+}
@@ -0,0 +1,181 @@
+// Package source enumerates repositories to back up from a variety of
+// hosting providers (GitHub, GitLab, Bitbucket, Gitea, and Gogs).
+package source
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/bhcleek/github-backup/config"
+)
+
+// hostOf extracts the hostname, minus any port, from a URL string. It
+// returns the input unchanged if it cannot be parsed as a URL.
+func hostOf(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return rawurl
+	}
+	return strings.Split(u.Host, ":")[0]
+}
+
+// RepoRef identifies a single repository discovered from a Source, along
+// with everything processQueue needs to mirror it.
+type RepoRef struct {
+	// Name is the "owner/repo" slug, used for logging.
+	Name string
+
+	// CloneURL is the URL git should clone/fetch from.
+	CloneURL string
+
+	// Host is the hostname the repository was discovered on. It drives the
+	// default <backupDir>/<host>/<path> mirror layout.
+	Host string
+
+	// Username and Token authenticate the CloneURL over HTTPS.
+	Username string
+	Token    string
+
+	// Destination overrides the base backup directory for this
+	// repository, when the owning provider configured one.
+	Destination string
+
+	// Destinations lists additional sinks, beyond the primary local
+	// mirror, that this repository should be fanned out to.
+	Destinations []config.Destination
+}
+
+// Source enumerates the repositories available from a single provider.
+// Implementations send human-readable progress and error messages on log
+// as they page through results, mirroring the behavior of the original
+// feedRepositoryQueue.
+type Source interface {
+	ListRepositories(ctx context.Context, log chan<- string) <-chan RepoRef
+}
+
+// filter narrows the repositories a Source emits, shared by every provider
+// implementation.
+type filter struct {
+	includeOwners  map[string]bool
+	includePattern *regexp.Regexp
+	excludeOwners  map[string]bool
+	excludePattern *regexp.Regexp
+	archived       bool
+	forks          bool
+	visibility     string
+}
+
+// newFilter builds a filter from p. An empty Provider includes everything;
+// archived repositories and forks are only dropped when the provider sets
+// Exclude.Archived/Exclude.Forks.
+func newFilter(p config.Provider) (*filter, error) {
+	f := &filter{
+		archived:   true,
+		forks:      true,
+		visibility: p.Visibility,
+	}
+
+	if len(p.Include.Owners) > 0 {
+		f.includeOwners = toSet(p.Include.Owners)
+	}
+	if len(p.Exclude.Owners) > 0 {
+		f.excludeOwners = toSet(p.Exclude.Owners)
+	}
+
+	var err error
+	if f.includePattern, err = compileAny(p.Include.Repos); err != nil {
+		return nil, err
+	}
+	if f.excludePattern, err = compileAny(p.Exclude.Repos); err != nil {
+		return nil, err
+	}
+	if p.Exclude.Archived {
+		f.archived = false
+	}
+	if p.Exclude.Forks {
+		f.forks = false
+	}
+
+	return f, nil
+}
+
+func toSet(items []string) map[string]bool {
+	set := make(map[string]bool, len(items))
+	for _, item := range items {
+		set[item] = true
+	}
+	return set
+}
+
+func compileAny(patterns []string) (*regexp.Regexp, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	combined := ""
+	for i, p := range patterns {
+		if i > 0 {
+			combined += "|"
+		}
+		combined += "(?:" + p + ")"
+	}
+	re, err := regexp.Compile(combined)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repo pattern: %v", err)
+	}
+	return re, nil
+}
+
+// allow reports whether a repository described by owner/name passes the
+// filter.
+func (f *filter) allow(owner, name string, archived, fork, private bool) bool {
+	slug := owner + "/" + name
+
+	if f.includeOwners != nil && !f.includeOwners[owner] {
+		return false
+	}
+	if f.excludeOwners != nil && f.excludeOwners[owner] {
+		return false
+	}
+	if f.includePattern != nil && !f.includePattern.MatchString(slug) {
+		return false
+	}
+	if f.excludePattern != nil && f.excludePattern.MatchString(slug) {
+		return false
+	}
+	if archived && !f.archived {
+		return false
+	}
+	if fork && !f.forks {
+		return false
+	}
+	switch f.visibility {
+	case "public":
+		return !private
+	case "private":
+		return private
+	default:
+		return true
+	}
+}
+
+// New builds the Source implementation for a configured provider.
+func New(p config.Provider) (Source, error) {
+	switch p.Type {
+	case "github":
+		return newGitHubSource(p)
+	case "gitlab":
+		return newGitLabSource(p)
+	case "bitbucket":
+		return newBitbucketSource(p)
+	case "gitea":
+		return newGiteaSource(p)
+	case "gogs":
+		return newGogsSource(p)
+	default:
+		return nil, fmt.Errorf("unknown provider type %q", p.Type)
+	}
+}